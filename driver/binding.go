@@ -0,0 +1,75 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"regexp"
+	"strings"
+)
+
+// queryBinding is one AddQueryBinding registration.
+type queryBinding struct {
+	pattern   *regexp.Regexp
+	rewritten string
+}
+
+// AddQueryBinding registers that any query matching originalPattern (a
+// regexp, anchored and matched case-insensitively the same way as
+// AddQueryPattern) is transparently rewritten to rewrittenQuery before cond
+// lookup -- mirroring TiDB's "CREATE GLOBAL BINDING FOR ... USING ...".
+//
+// Bindings are tried after exact conds and before patterns, in registration
+// order; a query can pass through more than one binding, each rewrite
+// feeding the next binding's match.
+func (th *TestHandler) AddQueryBinding(originalPattern string, rewrittenQuery string) {
+	expr := regexp.MustCompile("(?is)^" + originalPattern + "$")
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.bindings = append(th.bindings, queryBinding{pattern: expr, rewritten: strings.ToLower(rewrittenQuery)})
+}
+
+// rewriteQueryBinding applies every matching binding, in registration order,
+// returning the final rewritten query (or query unchanged if none matched).
+// th.mu must not be held.
+func (th *TestHandler) rewriteQueryBinding(query string) string {
+	th.mu.Lock()
+	bindings := th.bindings
+	th.mu.Unlock()
+
+	for _, b := range bindings {
+		if b.pattern.MatchString(query) {
+			query = b.rewritten
+		}
+	}
+	return query
+}
+
+// resolveBinding is called once matchAndRun has looked up cond for the
+// as-received query. If that lookup already hit (cond != nil), or no
+// binding rewrites it, it is returned unchanged. Otherwise the rewritten
+// query is looked up in turn -- counting towards GetQueryCalledNum on the
+// rewritten form, not just the original -- so tests can assert that a
+// client-side rewriter (or AddQueryBinding itself) produced the expected
+// canonical query.
+func (th *TestHandler) resolveBinding(query string, cond *Cond) (string, *Cond) {
+	if cond != nil {
+		return query, cond
+	}
+	rewritten := th.rewriteQueryBinding(query)
+	if rewritten == query {
+		return query, cond
+	}
+
+	th.mu.Lock()
+	th.queryCalled[rewritten]++
+	cond = th.conds[rewritten]
+	th.mu.Unlock()
+	return rewritten, cond
+}
@@ -0,0 +1,57 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/XeLabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// TestResolveBindingCountsRewrittenQuery ensures a query that only matches
+// after a binding rewrite is counted under the rewritten form, not just the
+// original -- see resolveBinding's doc comment on GetQueryCalledNum.
+func TestResolveBindingCountsRewrittenQuery(t *testing.T) {
+	th := &TestHandler{
+		conds:       make(map[string]*Cond),
+		queryCalled: make(map[string]int),
+	}
+	th.AddQuery("select * from t where a = 1", &sqltypes.Result{})
+	th.AddQueryBinding("select \\* from t where a in \\(1\\)", "select * from t where a = 1")
+
+	const original = "select * from t where a in (1)"
+	query, cond := th.resolveBinding(original, nil)
+
+	if query != "select * from t where a = 1" {
+		t.Fatalf("resolveBinding query = %q, want the rewritten form", query)
+	}
+	if cond == nil {
+		t.Fatalf("resolveBinding returned nil cond for the rewritten query")
+	}
+	if got := th.GetQueryCalledNum("select * from t where a = 1"); got != 1 {
+		t.Fatalf("GetQueryCalledNum(rewritten) = %d, want 1", got)
+	}
+}
+
+// TestResolveBindingNoOpWhenCondAlreadyMatched ensures an exact cond hit on
+// the original query short-circuits before any binding is consulted.
+func TestResolveBindingNoOpWhenCondAlreadyMatched(t *testing.T) {
+	th := &TestHandler{
+		conds:       make(map[string]*Cond),
+		queryCalled: make(map[string]int),
+	}
+	cond := &Cond{Type: COND_NORMAL, Query: "select 1", Result: &sqltypes.Result{}}
+	th.AddQueryBinding("select 1", "select 2")
+
+	query, got := th.resolveBinding("select 1", cond)
+	if query != "select 1" || got != cond {
+		t.Fatalf("resolveBinding rewrote a query that already had a cond match")
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"fmt"
+)
+
+// BinlogEventType enumerates the binlog event kinds TestHandler knows how to
+// script. It only covers what AddBinlogEvents/BinlogDump need, not the full
+// MySQL binlog event catalogue.
+type BinlogEventType int
+
+const (
+	BINLOG_ROTATE BinlogEventType = iota
+	BINLOG_FORMAT_DESCRIPTION
+	BINLOG_TABLE_MAP
+	BINLOG_WRITE_ROWS
+	BINLOG_UPDATE_ROWS
+	BINLOG_DELETE_ROWS
+	BINLOG_XID
+	BINLOG_GTID
+)
+
+// BinlogPosition identifies where in the binlog stream a dump should start,
+// either by file+offset (COM_BINLOG_DUMP) or by GTID set (COM_BINLOG_DUMP_GTID).
+type BinlogPosition struct {
+	File string
+	Pos  uint32
+	GTID string
+}
+
+// BinlogEvent is one canned event in a scripted replication stream. Data
+// carries the event body as it would appear on the wire, without the common
+// header or checksum; encodeBinlogNetworkPacket adds both when
+// DispatchBinlogCommand streams the event.
+type BinlogEvent struct {
+	Type     BinlogEventType
+	ServerID uint32
+	Data     []byte
+}
+
+// BinlogHandler is an optional sub-interface of Handler, discovered via type
+// assertion: a Handler that does not care about replication clients need not
+// implement it.
+type BinlogHandler interface {
+	RegisterSlave(s *Session, serverID uint32) error
+	BinlogDump(s *Session, pos BinlogPosition, callback func(event BinlogEvent) error) error
+}
+
+// AddBinlogEvents scripts the canned stream that BinlogDump replays for
+// every subsequent COM_BINLOG_DUMP / COM_BINLOG_DUMP_GTID, in order.
+func (th *TestHandler) AddBinlogEvents(events ...BinlogEvent) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.binlogEvents = append(th.binlogEvents, events...)
+}
+
+// RegisterSlave impl. TestHandler just remembers the announced serverID; it
+// does not reject duplicate registrations.
+func (th *TestHandler) RegisterSlave(s *Session, serverID uint32) error {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.slaveServerIDs = append(th.slaveServerIDs, serverID)
+	return nil
+}
+
+// BinlogDump impl. It replays the events scripted via AddBinlogEvents, in
+// order, starting from the beginning of the queue; pos is not used to seek
+// since TestHandler has no real binlog to seek into.
+func (th *TestHandler) BinlogDump(s *Session, pos BinlogPosition, callback func(event BinlogEvent) error) error {
+	th.mu.Lock()
+	events := make([]BinlogEvent, len(th.binlogEvents))
+	copy(events, th.binlogEvents)
+	th.mu.Unlock()
+
+	if len(events) == 0 {
+		return fmt.Errorf("mock.handler.binlog.dump.no.events.scripted.please.call.AddBinlogEvents.first")
+	}
+	for _, ev := range events {
+		if err := callback(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
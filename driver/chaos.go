@@ -0,0 +1,184 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// ChaosSchedule gates when a ChaosSpec is active, either by an absolute time
+// window or by a five-field cron expression (minute hour dom month dow, no
+// seconds field, standard "* / , -" semantics). At most one of the two
+// should be set; Cron takes precedence if both are.
+type ChaosSchedule struct {
+	Start time.Time
+	End   time.Time
+	Cron  string
+}
+
+// active reports whether the schedule gates chaos on at now.
+func (cs *ChaosSchedule) active(now time.Time) bool {
+	if cs == nil {
+		return true
+	}
+	if cs.Cron != "" {
+		ok, err := cronMatches(cs.Cron, now)
+		return err == nil && ok
+	}
+	if !cs.Start.IsZero() && now.Before(cs.Start) {
+		return false
+	}
+	if !cs.End.IsZero() && now.After(cs.End) {
+		return false
+	}
+	return true
+}
+
+// ChaosSpec describes probabilistic fault injection for a query, evaluated
+// by matchAndRun before it falls through to the normal cond path.
+type ChaosSpec struct {
+	// ErrorRate is the probability (0..1) that Error is returned instead of
+	// running the query normally.
+	ErrorRate float64
+	Error     error
+
+	// DelayJitter, if non-zero, adds a uniform random delay in
+	// [DelayJitter[0], DelayJitter[1]] milliseconds before the query runs.
+	DelayJitter [2]int
+
+	// DropRate is the probability (0..1) that the connection is silently
+	// closed instead of the query being answered at all.
+	DropRate float64
+
+	// Schedule, if set, gates when the rates above apply; outside of it the
+	// query runs normally. A nil Schedule means always active.
+	Schedule *ChaosSchedule
+}
+
+// AddQueryChaos registers probabilistic fault injection for query, evaluated
+// on every execution before the normal NORMAL/DELAY/ERROR/PANIC cond path.
+func (th *TestHandler) AddQueryChaos(query string, spec ChaosSpec) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	if th.chaosSpecs == nil {
+		th.chaosSpecs = make(map[string]*ChaosSpec)
+	}
+	th.chaosSpecs[strings.ToLower(query)] = &spec
+}
+
+// runChaos evaluates the chaos spec registered for query, if any. handled is
+// true when chaos fired (dropped the connection or returned Error) and the
+// caller should return err directly instead of continuing dispatch.
+func (th *TestHandler) runChaos(s *Session, sessTuple *SessionTuple, query string) (handled bool, err error) {
+	th.mu.Lock()
+	spec := th.chaosSpecs[query]
+	th.mu.Unlock()
+	if spec == nil || !spec.Schedule.active(time.Now()) {
+		return false, nil
+	}
+
+	if spec.DelayJitter[1] > 0 {
+		lo, hi := spec.DelayJitter[0], spec.DelayJitter[1]
+		ms := lo
+		if hi > lo {
+			ms += rand.Intn(hi - lo + 1)
+		}
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+	}
+
+	if spec.DropRate > 0 && rand.Float64() < spec.DropRate {
+		if sessTuple != nil {
+			sessTuple.closed = true
+			sessTuple.session.Close()
+		}
+		return true, fmt.Errorf("mock.handler.chaos[%s].connection.dropped", query)
+	}
+
+	if spec.ErrorRate > 0 && rand.Float64() < spec.ErrorRate {
+		if spec.Error != nil {
+			return true, spec.Error
+		}
+		return true, fmt.Errorf("mock.handler.chaos[%s].injected.error", query)
+	}
+
+	return false, nil
+}
+
+// cronMatches evaluates a standard five-field cron expression (minute hour
+// dom month dow) against now. Each field supports "*", "*/n", "a,b,c" and
+// "a-b", composed as "a-b/n".
+func cronMatches(expr string, now time.Time) (bool, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return false, fmt.Errorf("mock.handler.chaos.cron[%s].want.5.fields.got[%d]", expr, len(fields))
+	}
+
+	values := [5]int{now.Minute(), now.Hour(), now.Day(), int(now.Month()), int(now.Weekday())}
+	ranges := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+	for i, field := range fields {
+		ok, err := cronFieldMatches(field, values[i], ranges[i])
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func cronFieldMatches(field string, value int, bounds [2]int) (bool, error) {
+	for _, part := range strings.Split(field, ",") {
+		ok, err := cronPartMatches(part, value, bounds)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func cronPartMatches(part string, value int, bounds [2]int) (bool, error) {
+	step := 1
+	if idx := strings.Index(part, "/"); idx >= 0 {
+		n, err := fmt.Sscanf(part[idx+1:], "%d", &step)
+		if n != 1 || err != nil {
+			return false, fmt.Errorf("mock.handler.chaos.cron.bad.step[%s]", part)
+		}
+		part = part[:idx]
+	}
+
+	lo, hi := bounds[0], bounds[1]
+	switch {
+	case part == "*":
+		// lo/hi already cover the whole range.
+	case strings.Contains(part, "-"):
+		if _, err := fmt.Sscanf(part, "%d-%d", &lo, &hi); err != nil {
+			return false, fmt.Errorf("mock.handler.chaos.cron.bad.range[%s]", part)
+		}
+	default:
+		var n int
+		if _, err := fmt.Sscanf(part, "%d", &n); err != nil {
+			return false, fmt.Errorf("mock.handler.chaos.cron.bad.value[%s]", part)
+		}
+		return n == value, nil
+	}
+
+	if value < lo || value > hi {
+		return false, nil
+	}
+	return (value-lo)%step == 0, nil
+}
@@ -0,0 +1,149 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronPartMatchesStar(t *testing.T) {
+	ok, err := cronPartMatches("*", 37, [2]int{0, 59})
+	if err != nil || !ok {
+		t.Fatalf("cronPartMatches(*, 37) = (%v, %v), want (true, nil)", ok, err)
+	}
+}
+
+func TestCronPartMatchesStep(t *testing.T) {
+	bounds := [2]int{0, 59}
+	for _, tc := range []struct {
+		value int
+		want  bool
+	}{
+		{0, true},
+		{15, true},
+		{30, true},
+		{16, false},
+		{59, false},
+	} {
+		ok, err := cronPartMatches("*/15", tc.value, bounds)
+		if err != nil {
+			t.Fatalf("cronPartMatches(*/15, %d) error: %v", tc.value, err)
+		}
+		if ok != tc.want {
+			t.Fatalf("cronPartMatches(*/15, %d) = %v, want %v", tc.value, ok, tc.want)
+		}
+	}
+}
+
+func TestCronPartMatchesRangeWithStep(t *testing.T) {
+	bounds := [2]int{0, 59}
+	for _, tc := range []struct {
+		value int
+		want  bool
+	}{
+		{10, true},  // start of range
+		{15, true},  // 10 + 5
+		{20, true},  // 10 + 10, still <= hi
+		{16, false}, // in range but not on step
+		{9, false},  // below range
+		{21, false}, // above range
+	} {
+		ok, err := cronPartMatches("10-20/5", tc.value, bounds)
+		if err != nil {
+			t.Fatalf("cronPartMatches(10-20/5, %d) error: %v", tc.value, err)
+		}
+		if ok != tc.want {
+			t.Fatalf("cronPartMatches(10-20/5, %d) = %v, want %v", tc.value, ok, tc.want)
+		}
+	}
+}
+
+func TestCronFieldMatchesList(t *testing.T) {
+	bounds := [2]int{0, 59}
+	for _, tc := range []struct {
+		value int
+		want  bool
+	}{
+		{1, true},
+		{15, true},
+		{30, true},
+		{2, false},
+	} {
+		ok, err := cronFieldMatches("1,15,30", tc.value, bounds)
+		if err != nil {
+			t.Fatalf("cronFieldMatches(1,15,30, %d) error: %v", tc.value, err)
+		}
+		if ok != tc.want {
+			t.Fatalf("cronFieldMatches(1,15,30, %d) = %v, want %v", tc.value, ok, tc.want)
+		}
+	}
+}
+
+func TestCronMatchesAllFieldsMustAgree(t *testing.T) {
+	// Wednesday, 2026-07-15 14:30:00.
+	now := time.Date(2026, time.July, 15, 14, 30, 0, 0, time.UTC)
+
+	ok, err := cronMatches("30 14 15 7 *", now)
+	if err != nil || !ok {
+		t.Fatalf("cronMatches(exact match) = (%v, %v), want (true, nil)", ok, err)
+	}
+
+	ok, err = cronMatches("*/15 * * * *", now)
+	if err != nil || !ok {
+		t.Fatalf("cronMatches(*/15 minute) = (%v, %v), want (true, nil)", ok, err)
+	}
+
+	ok, err = cronMatches("31 14 15 7 *", now)
+	if err != nil || ok {
+		t.Fatalf("cronMatches(minute mismatch) = (%v, %v), want (false, nil)", ok, err)
+	}
+}
+
+func TestCronMatchesRejectsWrongFieldCount(t *testing.T) {
+	_, err := cronMatches("* * *", time.Now())
+	if err == nil {
+		t.Fatalf("cronMatches with 3 fields should error")
+	}
+}
+
+func TestChaosScheduleActiveWindow(t *testing.T) {
+	start := time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, time.July, 31, 0, 0, 0, 0, time.UTC)
+	cs := &ChaosSchedule{Start: start, End: end}
+
+	if cs.active(start.Add(-time.Second)) {
+		t.Fatalf("schedule should not be active before Start")
+	}
+	if !cs.active(start.Add(time.Hour)) {
+		t.Fatalf("schedule should be active inside the window")
+	}
+	if cs.active(end.Add(time.Second)) {
+		t.Fatalf("schedule should not be active after End")
+	}
+}
+
+func TestChaosScheduleNilIsAlwaysActive(t *testing.T) {
+	var cs *ChaosSchedule
+	if !cs.active(time.Now()) {
+		t.Fatalf("nil schedule should always be active")
+	}
+}
+
+func TestChaosScheduleCronTakesPrecedence(t *testing.T) {
+	now := time.Date(2026, time.July, 15, 14, 30, 0, 0, time.UTC)
+	cs := &ChaosSchedule{
+		Start: now.Add(time.Hour), // would otherwise make active() false
+		Cron:  "30 14 * * *",
+	}
+	if !cs.active(now) {
+		t.Fatalf("a matching Cron should override an otherwise-inactive Start/End window")
+	}
+}
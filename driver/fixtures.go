@@ -0,0 +1,279 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/XeLabs/go-mysqlstack/sqlparser/depends/querypb"
+	"github.com/XeLabs/go-mysqlstack/sqlparser/depends/sqltypes"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FixtureField describes one column of a fixture result set.
+type FixtureField struct {
+	Name    string `json:"name" yaml:"name"`
+	SQLType string `json:"sqltype" yaml:"sqltype"`
+}
+
+// FixtureEntry is one query<->result pair loaded from a fixture file. It is
+// the on-disk counterpart of Cond, modeled after Vitess's tabletserver
+// exec_cases.txt format.
+type FixtureEntry struct {
+	// Query is either a literal query (matched case-insensitively) or, when
+	// Pattern is true, a regexp matched the same way as AddQueryPattern.
+	Query   string `json:"query" yaml:"query"`
+	Pattern bool   `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+
+	Fields []FixtureField `json:"fields,omitempty" yaml:"fields,omitempty"`
+	Rows   [][]string     `json:"rows,omitempty" yaml:"rows,omitempty"`
+
+	RowsAffected uint64 `json:"rows_affected,omitempty" yaml:"rows_affected,omitempty"`
+	InsertID     uint64 `json:"insert_id,omitempty" yaml:"insert_id,omitempty"`
+
+	Delay  int    `json:"delay_ms,omitempty" yaml:"delay_ms,omitempty"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+	Panic  bool   `json:"panic,omitempty" yaml:"panic,omitempty"`
+	Stream bool   `json:"stream,omitempty" yaml:"stream,omitempty"`
+}
+
+// FixtureFile is the root object of a fixture file.
+type FixtureFile struct {
+	Queries []FixtureEntry `json:"queries" yaml:"queries"`
+}
+
+// validate checks that every row has exactly one cell per declared field;
+// a row with fewer or more cells than Fields is rejected.
+func (f *FixtureEntry) validate() error {
+	for i, row := range f.Rows {
+		if len(row) != len(f.Fields) {
+			return fmt.Errorf("mock.fixture.query[%s].row[%d].cells[%d].does.not.match.fields[%d]", f.Query, i, len(row), len(f.Fields))
+		}
+	}
+	return nil
+}
+
+// toResult turns the fixture's Fields/Rows/RowsAffected/InsertID into a
+// *sqltypes.Result, typing each cell according to its column's SQLType.
+func (f *FixtureEntry) toResult() (*sqltypes.Result, error) {
+	fields := make([]*querypb.Field, len(f.Fields))
+	types := make([]querypb.Type, len(f.Fields))
+	for i, ff := range f.Fields {
+		typ, ok := querypb.Type_value[strings.ToUpper(ff.SQLType)]
+		if !ok {
+			return nil, fmt.Errorf("mock.fixture.query[%s].field[%s].unknown.sqltype[%s]", f.Query, ff.Name, ff.SQLType)
+		}
+		fields[i] = &querypb.Field{Name: ff.Name, Type: querypb.Type(typ)}
+		types[i] = querypb.Type(typ)
+	}
+
+	rows := make([][]sqltypes.Value, len(f.Rows))
+	for i, row := range f.Rows {
+		vrow := make([]sqltypes.Value, len(row))
+		for j, cell := range row {
+			v, err := sqltypes.ValueFromBytes(types[j], []byte(cell))
+			if err != nil {
+				return nil, fmt.Errorf("mock.fixture.query[%s].row[%d].cell[%d].error:%+v", f.Query, i, j, err)
+			}
+			vrow[j] = v
+		}
+		rows[i] = vrow
+	}
+
+	return &sqltypes.Result{
+		Fields:       fields,
+		Rows:         rows,
+		RowsAffected: f.RowsAffected,
+		InsertID:     f.InsertID,
+	}, nil
+}
+
+func parseFixtureFile(path string, data []byte) (*FixtureFile, error) {
+	ff := &FixtureFile{}
+	switch {
+	case strings.HasSuffix(path, ".yml"), strings.HasSuffix(path, ".yaml"):
+		if err := yaml.Unmarshal(data, ff); err != nil {
+			return nil, err
+		}
+	default:
+		if err := json.Unmarshal(data, ff); err != nil {
+			return nil, err
+		}
+	}
+	return ff, nil
+}
+
+// loadFixtureFile registers every entry of ff via the existing
+// AddQuery/AddQueryPattern/AddQueryError paths.
+func (th *TestHandler) loadFixtureFile(ff *FixtureFile) error {
+	for _, entry := range ff.Queries {
+		entry := entry
+		if err := entry.validate(); err != nil {
+			return err
+		}
+
+		if entry.Error != "" {
+			if entry.Pattern {
+				th.AddQueryErrorPattern(entry.Query, fmt.Errorf("%s", entry.Error))
+			} else {
+				th.AddQueryError(entry.Query, fmt.Errorf("%s", entry.Error))
+			}
+			continue
+		}
+
+		if entry.Panic {
+			th.AddQueryPanic(entry.Query)
+			continue
+		}
+
+		result, err := entry.toResult()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.Pattern:
+			th.AddQueryPattern(entry.Query, result)
+		case entry.Stream:
+			th.AddQueryStream(entry.Query, result)
+		case entry.Delay > 0:
+			th.AddQueryDelay(entry.Query, result, entry.Delay)
+		default:
+			th.AddQuery(entry.Query, result)
+		}
+	}
+	return nil
+}
+
+// LoadFixtures reads a JSON or YAML file (selected by extension, JSON is the
+// default) describing canned query->result pairs and registers them via
+// AddQuery/AddQueryPattern/AddQueryError. This lets large mock corpora be
+// shared between tests without hundreds of AddQuery calls in Go code.
+func (th *TestHandler) LoadFixtures(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ff, err := parseFixtureFile(path, data)
+	if err != nil {
+		return err
+	}
+	return th.loadFixtureFile(ff)
+}
+
+// LoadFixturesFS is the fs.FS-based counterpart of LoadFixtures, useful for
+// reading fixtures embedded via go:embed.
+func (th *TestHandler) LoadFixturesFS(fsys fs.FS, path string) error {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return err
+	}
+	ff, err := parseFixtureFile(path, data)
+	if err != nil {
+		return err
+	}
+	return th.loadFixtureFile(ff)
+}
+
+// patternSource recovers the queryPattern text originally passed to
+// AddQueryPattern/AddQueryErrorPattern from the compiled regexp, undoing the
+// "(?is)^" + queryPattern + "$" wrapping those functions apply.
+func patternSource(expr *regexp.Regexp) string {
+	src := expr.String()
+	src = strings.TrimPrefix(src, "(?is)^")
+	return strings.TrimSuffix(src, "$")
+}
+
+// DumpFixtures serializes the currently-registered conds, patterns and
+// pattern errors back to a file, the inverse of LoadFixtures/LoadFixturesFS.
+// This is useful for record/replay: run a suite once against a real server
+// wired up through recording conds, then dump and check in the fixture
+// file.
+func (th *TestHandler) DumpFixtures(path string) error {
+	th.mu.Lock()
+	ff := &FixtureFile{}
+	for query, cond := range th.conds {
+		entry := FixtureEntry{Query: query}
+		switch cond.Type {
+		case COND_ERROR:
+			if cond.Error != nil {
+				entry.Error = cond.Error.Error()
+			}
+		case COND_PANIC:
+			entry.Panic = true
+		default:
+			if cond.Type == COND_DELAY {
+				entry.Delay = cond.Delay
+			}
+			if cond.Type == COND_STREAM {
+				entry.Stream = true
+			}
+			if cond.Result != nil {
+				entry.RowsAffected = cond.Result.RowsAffected
+				entry.InsertID = cond.Result.InsertID
+				for _, f := range cond.Result.Fields {
+					entry.Fields = append(entry.Fields, FixtureField{Name: f.Name, SQLType: f.Type.String()})
+				}
+				for _, row := range cond.Result.Rows {
+					cells := make([]string, len(row))
+					for i, v := range row {
+						cells[i] = v.String()
+					}
+					entry.Rows = append(entry.Rows, cells)
+				}
+			}
+		}
+		ff.Queries = append(ff.Queries, entry)
+	}
+	for _, pat := range th.patterns {
+		entry := FixtureEntry{Query: patternSource(pat.expr), Pattern: true}
+		if pat.result != nil {
+			entry.RowsAffected = pat.result.RowsAffected
+			entry.InsertID = pat.result.InsertID
+			for _, f := range pat.result.Fields {
+				entry.Fields = append(entry.Fields, FixtureField{Name: f.Name, SQLType: f.Type.String()})
+			}
+			for _, row := range pat.result.Rows {
+				cells := make([]string, len(row))
+				for i, v := range row {
+					cells[i] = v.String()
+				}
+				entry.Rows = append(entry.Rows, cells)
+			}
+		}
+		ff.Queries = append(ff.Queries, entry)
+	}
+	for _, pat := range th.patternErrors {
+		entry := FixtureEntry{Query: patternSource(pat.expr), Pattern: true}
+		if pat.err != nil {
+			entry.Error = pat.err.Error()
+		}
+		ff.Queries = append(ff.Queries, entry)
+	}
+	th.mu.Unlock()
+
+	var data []byte
+	var err error
+	if strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".yaml") {
+		data, err = yaml.Marshal(ff)
+	} else {
+		data, err = json.MarshalIndent(ff, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,165 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/XeLabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// TestDumpFixturesIncludesPatterns ensures DumpFixtures does not silently
+// drop entries registered via AddQueryPattern/AddQueryErrorPattern, which
+// live in th.patterns/th.patternErrors rather than th.conds.
+func TestDumpFixturesIncludesPatterns(t *testing.T) {
+	th := &TestHandler{}
+	th.AddQueryPattern("select .* from t", &sqltypes.Result{})
+	th.AddQueryErrorPattern("delete .* from t", fmt.Errorf("forbidden"))
+
+	path := t.TempDir() + "/fixtures.json"
+	if err := th.DumpFixtures(path); err != nil {
+		t.Fatalf("DumpFixtures error: %v", err)
+	}
+
+	dumped := &TestHandler{
+		conds:    make(map[string]*Cond),
+		condList: make(map[string]*CondList),
+	}
+	if err := dumped.LoadFixtures(path); err != nil {
+		t.Fatalf("LoadFixtures(dumped) error: %v", err)
+	}
+
+	dumped.mu.Lock()
+	defer dumped.mu.Unlock()
+	if len(dumped.patterns) != 1 {
+		t.Fatalf("round-tripped patterns = %d, want 1", len(dumped.patterns))
+	}
+	if len(dumped.patternErrors) != 1 {
+		t.Fatalf("round-tripped patternErrors = %d, want 1", len(dumped.patternErrors))
+	}
+}
+
+const fixtureJSON = `{
+  "queries": [
+    {
+      "query": "select id, name from t",
+      "fields": [
+        {"name": "id", "sqltype": "INT64"},
+        {"name": "name", "sqltype": "VARCHAR"}
+      ],
+      "rows": [["1", "alice"], ["2", "bob"]]
+    },
+    {
+      "query": "delete from t",
+      "error": "forbidden in this fixture"
+    }
+  ]
+}`
+
+const fixtureYAML = `
+queries:
+  - query: "select id, name from t"
+    fields:
+      - name: id
+        sqltype: INT64
+      - name: name
+        sqltype: VARCHAR
+    rows:
+      - ["1", "alice"]
+      - ["2", "bob"]
+  - query: "delete from t"
+    error: "forbidden in this fixture"
+`
+
+// newFixtureTestHandler builds a TestHandler with just enough initialized
+// state for LoadFixtures, bypassing NewTestHandler's *xlog.Log dependency.
+func newFixtureTestHandler() *TestHandler {
+	return &TestHandler{
+		conds:       make(map[string]*Cond),
+		condList:    make(map[string]*CondList),
+		queryCalled: make(map[string]int),
+	}
+}
+
+// TestLoadFixturesJSON ensures a JSON fixture file loads its normal query
+// entry (typing each row cell per its column's declared SQLType) and its
+// error entry.
+func TestLoadFixturesJSON(t *testing.T) {
+	path := t.TempDir() + "/fixtures.json"
+	if err := writeFile(path, fixtureJSON); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	th := newFixtureTestHandler()
+	if err := th.LoadFixtures(path); err != nil {
+		t.Fatalf("LoadFixtures error: %v", err)
+	}
+
+	cond := th.conds["select id, name from t"]
+	if cond == nil {
+		t.Fatalf("query not loaded into th.conds")
+	}
+	if len(cond.Result.Rows) != 2 {
+		t.Fatalf("Rows = %d, want 2", len(cond.Result.Rows))
+	}
+	if got := cond.Result.Rows[1][1].String(); got != "bob" {
+		t.Fatalf("Rows[1][1] = %q, want %q", got, "bob")
+	}
+
+	errCond := th.conds["delete from t"]
+	if errCond == nil || errCond.Type != COND_ERROR || errCond.Error == nil {
+		t.Fatalf("error entry not loaded as COND_ERROR: %+v", errCond)
+	}
+	if errCond.Error.Error() != "forbidden in this fixture" {
+		t.Fatalf("error text = %q, want %q", errCond.Error.Error(), "forbidden in this fixture")
+	}
+}
+
+// TestLoadFixturesYAML is the YAML-format counterpart of
+// TestLoadFixturesJSON, selected by the ".yaml" extension.
+func TestLoadFixturesYAML(t *testing.T) {
+	path := t.TempDir() + "/fixtures.yaml"
+	if err := writeFile(path, fixtureYAML); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	th := newFixtureTestHandler()
+	if err := th.LoadFixtures(path); err != nil {
+		t.Fatalf("LoadFixtures error: %v", err)
+	}
+
+	cond := th.conds["select id, name from t"]
+	if cond == nil {
+		t.Fatalf("query not loaded into th.conds")
+	}
+	if got := cond.Result.Rows[0][0].String(); got != "1" {
+		t.Fatalf("Rows[0][0] = %q, want %q", got, "1")
+	}
+}
+
+// TestFixtureEntryValidateRejectsMismatchedRowWidth ensures validate()
+// rejects a row whose cell count doesn't match the declared field count,
+// the check LoadFixtures relies on to reject malformed fixture files.
+func TestFixtureEntryValidateRejectsMismatchedRowWidth(t *testing.T) {
+	entry := FixtureEntry{
+		Query:  "select a, b from t",
+		Fields: []FixtureField{{Name: "a", SQLType: "INT64"}, {Name: "b", SQLType: "INT64"}},
+		Rows:   [][]string{{"1"}},
+	}
+	if err := entry.validate(); err == nil {
+		t.Fatalf("validate() should reject a row with 1 cell against 2 declared fields")
+	}
+}
+
+func writeFile(path, contents string) error {
+	return ioutil.WriteFile(path, []byte(contents), 0644)
+}
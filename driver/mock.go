@@ -78,6 +78,13 @@ type SessionTuple struct {
 	session *Session
 	closed  bool
 	killed  chan bool
+
+	// Transaction/session state tracked on behalf of ComQuery; see txn.go.
+	inTxn       bool
+	autocommit  bool
+	sessionVars map[string]string
+	currentDB   string
+	txnQueries  []string
 }
 
 // Test Handler
@@ -94,15 +101,45 @@ type TestHandler struct {
 
 	// How many times a query was called.
 	queryCalled map[string]int
+
+	// Prepared statements, keyed by statement ID, and parameter-sensitive
+	// bindings registered via AddPreparedQuery, keyed by lower-cased query.
+	stmts           map[uint32]*preparedStmt
+	stmtSeq         uint32
+	preparedQueries map[string]*preparedQuery
+
+	// Scripted replication stream, served by BinlogDump, and the server IDs
+	// announced through RegisterSlave.
+	binlogEvents   []BinlogEvent
+	slaveServerIDs []uint32
+
+	// Pending AddTransactionExpectation calls, queued per session ID, and
+	// the failures recorded when one of them went unsatisfied; see txn.go.
+	txnExpectations map[uint32][][]string
+	txnFailures     []error
+
+	// qlogger, if set via SetQueryLogger, receives a QueryLogEntry per
+	// executed query; see querylog.go.
+	qlogger QueryLogger
+
+	// chaosSpecs holds the fault-injection specs registered via
+	// AddQueryChaos, keyed by lower-cased query; see chaos.go.
+	chaosSpecs map[string]*ChaosSpec
+
+	// bindings holds the query rewrites registered via AddQueryBinding, in
+	// registration order; see binding.go.
+	bindings []queryBinding
 }
 
 func NewTestHandler(log *xlog.Log) *TestHandler {
 	return &TestHandler{
-		log:         log,
-		ss:          make(map[uint32]*SessionTuple),
-		conds:       make(map[string]*Cond),
-		queryCalled: make(map[string]int),
-		condList:    make(map[string]*CondList),
+		log:             log,
+		ss:              make(map[uint32]*SessionTuple),
+		conds:           make(map[string]*Cond),
+		queryCalled:     make(map[string]int),
+		condList:        make(map[string]*CondList),
+		stmts:           make(map[uint32]*preparedStmt),
+		preparedQueries: make(map[string]*preparedQuery),
 	}
 }
 
@@ -156,8 +193,10 @@ func (th *TestHandler) NewSession(s *Session) {
 	th.mu.Lock()
 	defer th.mu.Unlock()
 	st := &SessionTuple{
-		session: s,
-		killed:  make(chan bool, 2),
+		session:     s,
+		killed:      make(chan bool, 2),
+		autocommit:  true,
+		sessionVars: make(map[string]string),
 	}
 	th.ss[s.ID()] = st
 }
@@ -179,15 +218,82 @@ func (th *TestHandler) ComInitDB(s *Session, db string) error {
 
 // ComQuery impl.
 func (th *TestHandler) ComQuery(s *Session, query string, callback func(qr *sqltypes.Result) error) error {
+	return th.execQuery(s, strings.ToLower(query), nil, callback)
+}
+
+// execQuery is the shared dispatch core behind ComQuery and, since prepared
+// statements are substituted into a plain query string before lookup,
+// ComStmtExecute. query must already be lower-cased. bindVars is logged
+// verbatim and may be nil (ComQuery has none).
+func (th *TestHandler) execQuery(s *Session, query string, bindVars map[string]string, callback func(qr *sqltypes.Result) error) error {
+	start := time.Now()
+	schema := s.Schema()
+	th.mu.Lock()
+	if sessTuple := th.ss[s.ID()]; sessTuple != nil && sessTuple.currentDB != "" {
+		schema = sessTuple.currentDB
+	}
+	th.mu.Unlock()
+
+	entry := QueryLogEntry{
+		SessionID:  s.ID(),
+		RemoteAddr: s.Addr(),
+		User:       s.User(),
+		Schema:     schema,
+		Query:      query,
+		BindVars:   bindVars,
+		StartTime:  start,
+	}
+
+	wrapped := func(qr *sqltypes.Result) error {
+		if qr != nil {
+			entry.RowsReturned += len(qr.Rows)
+			entry.RowsAffected = qr.RowsAffected
+		}
+		return callback(qr)
+	}
+
+	matched, err := th.matchAndRun(s, query, wrapped)
+	entry.MatchedCond = matched
+	entry.Duration = time.Since(start)
+	entry.Error = err
+	th.logQuery(entry)
+	return err
+}
+
+// matchAndRun is the cond-dispatch core behind execQuery: BEGIN/COMMIT/SET/
+// USE are handled first since they don't consult th.conds, then any
+// AddQueryChaos spec gets a chance to fire. Exact conds are tried next,
+// then AddQueryBinding rewrites (composed in registration order) are
+// applied and conds re-checked against the rewritten query, and only then
+// are KILL, patterns and finally condLists tried.
+func (th *TestHandler) matchAndRun(s *Session, query string, callback func(qr *sqltypes.Result) error) (MatchedCond, error) {
 	log := th.log
-	query = strings.ToLower(query)
 
 	th.mu.Lock()
 	th.queryCalled[query]++
-	cond := th.conds[query]
 	sessTuple := th.ss[s.ID()]
 	th.mu.Unlock()
 
+	if handled, err := th.handleSessionStateQuery(sessTuple, query, callback); handled {
+		return MATCH_NORMAL, err
+	}
+
+	if sessTuple != nil && sessTuple.inTxn {
+		th.mu.Lock()
+		sessTuple.txnQueries = append(sessTuple.txnQueries, query)
+		th.mu.Unlock()
+	}
+
+	if handled, err := th.runChaos(s, sessTuple, query); handled {
+		return MATCH_ERROR, err
+	}
+
+	th.mu.Lock()
+	cond := th.conds[query]
+	th.mu.Unlock()
+
+	query, cond = th.resolveBinding(query, cond)
+
 	if cond != nil {
 		switch cond.Type {
 		case COND_DELAY:
@@ -195,25 +301,25 @@ func (th *TestHandler) ComQuery(s *Session, query string, callback func(qr *sqlt
 			select {
 			case <-sessTuple.killed:
 				sessTuple.closed = true
-				return fmt.Errorf("mock.session[%v].query[%s].was.killed...", s.ID(), query)
+				return MATCH_DELAY, fmt.Errorf("mock.session[%v].query[%s].was.killed...", s.ID(), query)
 			case <-time.After(time.Millisecond * time.Duration(cond.Delay)):
 				log.Debug("mock.handler.delay.done...")
 			}
 			callback(cond.Result)
-			return nil
+			return MATCH_DELAY, nil
 		case COND_ERROR:
-			return cond.Error
+			return MATCH_ERROR, cond.Error
 		case COND_PANIC:
 			log.Panic("mock.handler.panic....")
 		case COND_NORMAL:
 			callback(cond.Result)
-			return nil
+			return MATCH_NORMAL, nil
 		case COND_STREAM:
 			flds := cond.Result.Fields
 			// Send Fields for stream.
 			qr := &sqltypes.Result{Fields: flds, State: sqltypes.RState_Fields}
 			if err := callback(qr); err != nil {
-				return fmt.Errorf("mock.handler.send.stream.error:%+v", err)
+				return MATCH_NORMAL, fmt.Errorf("mock.handler.send.stream.error:%+v", err)
 			}
 
 			// Send Row by row for stream.
@@ -221,16 +327,16 @@ func (th *TestHandler) ComQuery(s *Session, query string, callback func(qr *sqlt
 				qr := &sqltypes.Result{Fields: flds, State: sqltypes.RState_Rows}
 				qr.Rows = append(qr.Rows, row)
 				if err := callback(qr); err != nil {
-					return fmt.Errorf("mock.handler.send.stream.error:%+v", err)
+					return MATCH_NORMAL, fmt.Errorf("mock.handler.send.stream.error:%+v", err)
 				}
 			}
 
 			// Send EOF for stream.
 			qr = &sqltypes.Result{Fields: flds, State: sqltypes.RState_Finished}
 			if err := callback(qr); err != nil {
-				return fmt.Errorf("mock.handler.send.stream.error:%+v", err)
+				return MATCH_NORMAL, fmt.Errorf("mock.handler.send.stream.error:%+v", err)
 			}
-			return nil
+			return MATCH_NORMAL, nil
 		}
 	}
 
@@ -249,7 +355,7 @@ func (th *TestHandler) ComQuery(s *Session, query string, callback func(qr *sqlt
 			th.mu.Unlock()
 		}
 		callback(&sqltypes.Result{})
-		return nil
+		return MATCH_NORMAL, nil
 	}
 
 	th.mu.Lock()
@@ -257,13 +363,13 @@ func (th *TestHandler) ComQuery(s *Session, query string, callback func(qr *sqlt
 	// Check query patterns from AddQueryPattern().
 	for _, pat := range th.patternErrors {
 		if pat.expr.MatchString(query) {
-			return pat.err
+			return MATCH_PATTERN, pat.err
 		}
 	}
 	for _, pat := range th.patterns {
 		if pat.expr.MatchString(query) {
 			callback(pat.result)
-			return nil
+			return MATCH_PATTERN, nil
 		}
 	}
 
@@ -276,10 +382,10 @@ func (th *TestHandler) ComQuery(s *Session, query string, callback func(qr *sqlt
 			v.idx++
 		}
 		callback(v.conds[idx].Result)
-		return nil
+		return MATCH_CONDLIST, nil
 	}
 
-	return fmt.Errorf("mock.handler.query[%v].error[can.not.found.the.cond.please.set.first]", query)
+	return MATCH_UNMATCHED, fmt.Errorf("mock.handler.query[%v].error[can.not.found.the.cond.please.set.first]", query)
 }
 
 // AddQuery used to add a query and its expected result.
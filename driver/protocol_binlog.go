@@ -0,0 +1,158 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/XeLabs/go-mysqlstack/sqldb"
+)
+
+// This file is the wire-level counterpart of binlog.go: it decodes
+// COM_REGISTER_SLAVE/COM_BINLOG_DUMP/COM_BINLOG_DUMP_GTID packet bodies and
+// frames BinlogEvent as real binlog-stream packets (19-byte common header +
+// CRC32 checksum trailer). DispatchBinlogCommand is the entry point for
+// these three command bytes. Listener's packet loop does not call it.
+
+// binlogEventTypeCode maps a BinlogEventType to the MySQL binlog event-type
+// byte that goes in its common header. It only covers what BinlogEventType
+// enumerates, not the full binlog event catalogue.
+var binlogEventTypeCode = map[BinlogEventType]byte{
+	BINLOG_ROTATE:             0x04,
+	BINLOG_FORMAT_DESCRIPTION: 0x0f,
+	BINLOG_TABLE_MAP:          0x13,
+	BINLOG_WRITE_ROWS:         0x1e,
+	BINLOG_UPDATE_ROWS:        0x1f,
+	BINLOG_DELETE_ROWS:        0x20,
+	BINLOG_XID:                0x10,
+	BINLOG_GTID:               0x21,
+}
+
+// DispatchBinlogCommand decodes one COM_REGISTER_SLAVE / COM_BINLOG_DUMP /
+// COM_BINLOG_DUMP_GTID packet (payload includes the leading command byte),
+// drives it through h, and, for the two dump commands, streams each scripted
+// BinlogEvent to writePacket as a framed binlog-network packet.
+func DispatchBinlogCommand(h BinlogHandler, s *Session, payload []byte, writePacket func([]byte) error) error {
+	if len(payload) == 0 {
+		return fmt.Errorf("mock.protocol.binlog.empty.packet")
+	}
+	comID, body := payload[0], payload[1:]
+
+	switch comID {
+	case sqldb.COM_REGISTER_SLAVE:
+		serverID, err := decodeRegisterSlave(body)
+		if err != nil {
+			return err
+		}
+		return h.RegisterSlave(s, serverID)
+
+	case sqldb.COM_BINLOG_DUMP:
+		pos, err := decodeBinlogDump(body)
+		if err != nil {
+			return err
+		}
+		return h.BinlogDump(s, pos, func(ev BinlogEvent) error {
+			return writePacket(encodeBinlogNetworkPacket(ev))
+		})
+
+	case sqldb.COM_BINLOG_DUMP_GTID:
+		pos, err := decodeBinlogDumpGTID(body)
+		if err != nil {
+			return err
+		}
+		return h.BinlogDump(s, pos, func(ev BinlogEvent) error {
+			return writePacket(encodeBinlogNetworkPacket(ev))
+		})
+	}
+
+	return fmt.Errorf("mock.protocol.binlog.unknown.command[%v]", comID)
+}
+
+// decodeRegisterSlave parses a COM_REGISTER_SLAVE body far enough to pull
+// out the replica's reported server-id (the first 4 bytes); the
+// hostname/user/password/port/rank/master-id fields that follow aren't
+// needed by TestHandler.RegisterSlave.
+func decodeRegisterSlave(body []byte) (uint32, error) {
+	if len(body) < 4 {
+		return 0, fmt.Errorf("mock.protocol.binlog.register.slave.packet.too.short")
+	}
+	return binary.LittleEndian.Uint32(body[0:4]), nil
+}
+
+// decodeBinlogDump parses a COM_BINLOG_DUMP body: position(4) + flags(2) +
+// server-id(4) + binlog-filename.
+func decodeBinlogDump(body []byte) (BinlogPosition, error) {
+	if len(body) < 10 {
+		return BinlogPosition{}, fmt.Errorf("mock.protocol.binlog.dump.packet.too.short")
+	}
+	pos := binary.LittleEndian.Uint32(body[0:4])
+	filename := string(body[10:])
+	return BinlogPosition{File: filename, Pos: pos}, nil
+}
+
+// decodeBinlogDumpGTID parses a COM_BINLOG_DUMP_GTID body: flags(2) +
+// server-id(4) + binlog-filename-len(4) + binlog-filename + position(8) +
+// data-size(4) + gtid-set-data. The textual GTID set encoding is
+// implementation-defined; TestHandler only needs the raw bytes to hand back
+// via BinlogPosition.GTID.
+func decodeBinlogDumpGTID(body []byte) (BinlogPosition, error) {
+	if len(body) < 10 {
+		return BinlogPosition{}, fmt.Errorf("mock.protocol.binlog.dump.gtid.packet.too.short")
+	}
+	nameLen := binary.LittleEndian.Uint32(body[6:10])
+	cursor := 10 + int(nameLen)
+	if len(body) < cursor+8 {
+		return BinlogPosition{}, fmt.Errorf("mock.protocol.binlog.dump.gtid.packet.too.short")
+	}
+	filename := string(body[10:cursor])
+	posLow := binary.LittleEndian.Uint32(body[cursor : cursor+4])
+	cursor += 8
+
+	var gtid string
+	if len(body) >= cursor+4 {
+		dataSize := binary.LittleEndian.Uint32(body[cursor : cursor+4])
+		cursor += 4
+		if len(body) >= cursor+int(dataSize) {
+			gtid = string(body[cursor : cursor+int(dataSize)])
+		}
+	}
+	return BinlogPosition{File: filename, Pos: posLow, GTID: gtid}, nil
+}
+
+// encodeBinlogNetworkPacket frames ev as it would appear in a real
+// COM_BINLOG_DUMP network stream: a leading 0x00 status byte (no error),
+// followed by the 19-byte binlog common header, ev.Data, and a trailing
+// 4-byte CRC32 checksum -- the default since MySQL 5.6 when
+// binlog_checksum=CRC32, which is what a modern replication client expects
+// to find and validate.
+func encodeBinlogNetworkPacket(ev BinlogEvent) []byte {
+	header := make([]byte, 19)
+	// timestamp(4) is left zero: TestHandler's scripted events have no
+	// real wall-clock origin.
+	header[4] = binlogEventTypeCode[ev.Type]
+	binary.LittleEndian.PutUint32(header[5:9], ev.ServerID)
+	eventLen := 19 + len(ev.Data) + 4 // header + body + checksum
+	binary.LittleEndian.PutUint32(header[9:13], uint32(eventLen))
+	// log-pos(4) at [13:17] is left zero: not seekable without a real log.
+	// flags(2) at [17:19] is left zero.
+
+	body := make([]byte, 0, 1+eventLen)
+	body = append(body, 0x00) // OK status byte
+	body = append(body, header...)
+	body = append(body, ev.Data...)
+
+	checksum := crc32.ChecksumIEEE(body[1:])
+	checksumBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(checksumBytes, checksum)
+	body = append(body, checksumBytes...)
+	return body
+}
@@ -0,0 +1,305 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/XeLabs/go-mysqlstack/sqldb"
+	"github.com/XeLabs/go-mysqlstack/sqlparser/depends/querypb"
+	"github.com/XeLabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// This file is the wire-level counterpart of stmt.go: it decodes
+// COM_STMT_PREPARE/COM_STMT_EXECUTE/COM_STMT_CLOSE packet bodies and encodes
+// BinaryRow responses per the MySQL binary protocol. DispatchComStmt is the
+// entry point for one such packet, taking its payload with the 4-byte packet
+// header already stripped. Listener's packet loop does not call it.
+
+// stmtParamCounter is an optional sub-interface of Handler, discovered via
+// type assertion the same way BinlogHandler is: it exposes the bound param
+// count of a still-open prepared statement so DispatchComStmt can size a
+// COM_STMT_EXECUTE packet's NULL bitmap exactly, instead of guessing it
+// from the packet bytes alone.
+type stmtParamCounter interface {
+	StmtParamCount(stmtID uint32) (int, bool)
+}
+
+// DispatchComStmt decodes one COM_STMT_* packet (payload includes the
+// leading command byte), drives it through h's prepared-statement methods,
+// and writes the wire response via writePacket. h must also implement
+// stmtParamCounter for COM_STMT_EXECUTE to be decodable.
+func DispatchComStmt(h Handler, s *Session, payload []byte, writePacket func([]byte) error) error {
+	if len(payload) == 0 {
+		return fmt.Errorf("mock.protocol.stmt.empty.packet")
+	}
+	comID, body := payload[0], payload[1:]
+
+	switch comID {
+	case sqldb.COM_STMT_PREPARE:
+		stmtID, paramCount, _, err := h.ComStmtPrepare(s, string(body))
+		if err != nil {
+			return writePacket(encodeErrPacket(err))
+		}
+		return writePacket(encodeStmtPrepareOK(stmtID, paramCount))
+
+	case sqldb.COM_STMT_EXECUTE:
+		if len(body) < 4 {
+			return writePacket(encodeErrPacket(fmt.Errorf("mock.protocol.stmt.execute.packet.too.short")))
+		}
+		stmtID := binary.LittleEndian.Uint32(body[0:4])
+
+		counter, ok := h.(stmtParamCounter)
+		if !ok {
+			return fmt.Errorf("mock.protocol.stmt.execute.handler.does.not.implement.stmtParamCounter")
+		}
+		paramCount, ok := counter.StmtParamCount(stmtID)
+		if !ok {
+			return writePacket(encodeErrPacket(fmt.Errorf("mock.handler.stmt[%v].not.found.please.prepare.first", stmtID)))
+		}
+
+		params, err := decodeComStmtExecute(body, paramCount)
+		if err != nil {
+			return writePacket(encodeErrPacket(err))
+		}
+		werr := h.ComStmtExecute(s, stmtID, params, func(qr *sqltypes.Result) error {
+			for _, row := range qr.Rows {
+				if err := writePacket(encodeBinaryRow(qr.Fields, row)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if werr != nil {
+			return writePacket(encodeErrPacket(werr))
+		}
+		return nil
+
+	case sqldb.COM_STMT_CLOSE:
+		if len(body) < 4 {
+			return fmt.Errorf("mock.protocol.stmt.close.packet.too.short")
+		}
+		h.ComStmtClose(s, binary.LittleEndian.Uint32(body[:4]))
+		// COM_STMT_CLOSE has no response, per protocol.
+		return nil
+	}
+
+	return fmt.Errorf("mock.protocol.stmt.unknown.command[%v]", comID)
+}
+
+// decodeComStmtExecute parses a COM_STMT_EXECUTE packet body (command byte
+// already stripped): statement-id(4) + flags(1) + iteration-count(4),
+// followed, when paramCount > 0, by a NULL bitmap of exactly
+// ceil(paramCount/8) bytes, a new-params-bound byte which must be 1, and
+// then one (type, unsigned-flag) pair per param followed by their
+// binary-encoded values -- paramCount is supplied by the caller (from the
+// PREPARE this statement was registered with) rather than guessed, since
+// nothing on the wire itself carries it.
+func decodeComStmtExecute(body []byte, paramCount int) ([]sqltypes.Value, error) {
+	if len(body) < 9 {
+		return nil, fmt.Errorf("mock.protocol.stmt.execute.packet.too.short")
+	}
+	if paramCount == 0 {
+		return nil, nil
+	}
+
+	tail := body[9:]
+	bitmapLen := (paramCount + 7) / 8
+	if len(tail) < bitmapLen+1 {
+		return nil, fmt.Errorf("mock.protocol.stmt.execute.packet.too.short.for.null.bitmap")
+	}
+	if newParamsBound := tail[bitmapLen]; newParamsBound != 1 {
+		return nil, fmt.Errorf("mock.protocol.stmt.execute.new.params.bound[%d].want[1]", newParamsBound)
+	}
+	return decodeBoundValues(tail[bitmapLen+1:], paramCount)
+}
+
+// decodeBoundValues decodes the type array + values tail of a
+// COM_STMT_EXECUTE packet (the NULL bitmap and new-params-bound byte
+// already consumed): exactly one (type, unsigned-flag) pair per param,
+// followed by one value per param.
+func decodeBoundValues(data []byte, paramCount int) ([]sqltypes.Value, error) {
+	if len(data) < paramCount*2 {
+		return nil, fmt.Errorf("mock.protocol.stmt.execute.packet.too.short.for.type.array")
+	}
+	types := make([]querypb.Type, paramCount)
+	for i := 0; i < paramCount; i++ {
+		types[i] = querypb.Type(data[i*2])
+	}
+
+	values := make([]sqltypes.Value, 0, paramCount)
+	valPos := paramCount * 2
+	for _, typ := range types {
+		v, next, err := decodeBinaryValue(typ, data, valPos)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		valPos = next
+	}
+	return values, nil
+}
+
+// decodeBinaryValue decodes one value of type typ starting at data[pos],
+// returning the value and the position just past it.
+func decodeBinaryValue(typ querypb.Type, data []byte, pos int) (sqltypes.Value, int, error) {
+	switch typ {
+	case querypb.Type_INT8, querypb.Type_UINT8:
+		if pos+1 > len(data) {
+			return sqltypes.Value{}, 0, fmt.Errorf("mock.protocol.stmt.decode.int8.truncated")
+		}
+		return sqltypes.MakeTrusted(typ, []byte(fmt.Sprintf("%d", data[pos]))), pos + 1, nil
+
+	case querypb.Type_INT16, querypb.Type_UINT16:
+		if pos+2 > len(data) {
+			return sqltypes.Value{}, 0, fmt.Errorf("mock.protocol.stmt.decode.int16.truncated")
+		}
+		n := binary.LittleEndian.Uint16(data[pos : pos+2])
+		return sqltypes.MakeTrusted(typ, []byte(fmt.Sprintf("%d", n))), pos + 2, nil
+
+	case querypb.Type_INT32, querypb.Type_UINT32, querypb.Type_FLOAT32:
+		if pos+4 > len(data) {
+			return sqltypes.Value{}, 0, fmt.Errorf("mock.protocol.stmt.decode.int32.truncated")
+		}
+		bits := binary.LittleEndian.Uint32(data[pos : pos+4])
+		if typ == querypb.Type_FLOAT32 {
+			return sqltypes.MakeTrusted(typ, []byte(fmt.Sprintf("%g", math.Float32frombits(bits)))), pos + 4, nil
+		}
+		return sqltypes.MakeTrusted(typ, []byte(fmt.Sprintf("%d", bits))), pos + 4, nil
+
+	case querypb.Type_INT64, querypb.Type_UINT64, querypb.Type_FLOAT64:
+		if pos+8 > len(data) {
+			return sqltypes.Value{}, 0, fmt.Errorf("mock.protocol.stmt.decode.int64.truncated")
+		}
+		bits := binary.LittleEndian.Uint64(data[pos : pos+8])
+		if typ == querypb.Type_FLOAT64 {
+			return sqltypes.MakeTrusted(typ, []byte(fmt.Sprintf("%g", math.Float64frombits(bits)))), pos + 8, nil
+		}
+		return sqltypes.MakeTrusted(typ, []byte(fmt.Sprintf("%d", bits))), pos + 8, nil
+
+	case querypb.Type_NULL_TYPE:
+		return sqltypes.NULL, pos, nil
+
+	default:
+		// VARCHAR/VARBINARY/everything else: length-encoded string.
+		n, next, err := decodeLenEncInt(data, pos)
+		if err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		if next+int(n) > len(data) {
+			return sqltypes.Value{}, 0, fmt.Errorf("mock.protocol.stmt.decode.string.truncated")
+		}
+		return sqltypes.MakeTrusted(typ, data[next:next+int(n)]), next + int(n), nil
+	}
+}
+
+// decodeLenEncInt decodes a MySQL length-encoded integer starting at
+// data[pos], returning its value and the position just past it.
+func decodeLenEncInt(data []byte, pos int) (uint64, int, error) {
+	if pos >= len(data) {
+		return 0, 0, fmt.Errorf("mock.protocol.stmt.decode.lenenc.truncated")
+	}
+	switch b := data[pos]; {
+	case b < 0xfb:
+		return uint64(b), pos + 1, nil
+	case b == 0xfc:
+		if pos+3 > len(data) {
+			return 0, 0, fmt.Errorf("mock.protocol.stmt.decode.lenenc16.truncated")
+		}
+		return uint64(binary.LittleEndian.Uint16(data[pos+1 : pos+3])), pos + 3, nil
+	case b == 0xfd:
+		if pos+4 > len(data) {
+			return 0, 0, fmt.Errorf("mock.protocol.stmt.decode.lenenc24.truncated")
+		}
+		return uint64(data[pos+1]) | uint64(data[pos+2])<<8 | uint64(data[pos+3])<<16, pos + 4, nil
+	case b == 0xfe:
+		if pos+9 > len(data) {
+			return 0, 0, fmt.Errorf("mock.protocol.stmt.decode.lenenc64.truncated")
+		}
+		return binary.LittleEndian.Uint64(data[pos+1 : pos+9]), pos + 9, nil
+	}
+	return 0, 0, fmt.Errorf("mock.protocol.stmt.decode.lenenc.invalid")
+}
+
+// encodeLenEncInt appends the MySQL length-encoded-integer form of n to buf.
+func encodeLenEncInt(buf []byte, n uint64) []byte {
+	switch {
+	case n < 0xfb:
+		return append(buf, byte(n))
+	case n < 1<<16:
+		buf = append(buf, 0xfc)
+		return append(buf, byte(n), byte(n>>8))
+	case n < 1<<24:
+		buf = append(buf, 0xfd)
+		return append(buf, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		buf = append(buf, 0xfe)
+		for i := 0; i < 8; i++ {
+			buf = append(buf, byte(n>>(8*uint(i))))
+		}
+		return buf
+	}
+}
+
+// encodeBinaryRow encodes one row of a COM_STMT_EXECUTE result set as a
+// BinaryRow packet: a 0x00 header byte, a NULL bitmap (bit offset by 2 per
+// protocol), then each non-NULL value as a length-encoded string. Values are
+// re-encoded generically from their text form rather than the fixed-width
+// int/float wire forms, since TestHandler's results are built from
+// text/bytes to begin with.
+func encodeBinaryRow(fields []*querypb.Field, row []sqltypes.Value) []byte {
+	bitmapLen := (len(fields) + 2 + 7) / 8
+	bitmap := make([]byte, bitmapLen)
+	for i, v := range row {
+		if v.IsNull() {
+			bitPos := i + 2
+			bitmap[bitPos/8] |= 1 << uint(bitPos%8)
+		}
+	}
+
+	buf := []byte{0x00}
+	buf = append(buf, bitmap...)
+	for _, v := range row {
+		if v.IsNull() {
+			continue
+		}
+		raw := v.Raw()
+		buf = encodeLenEncInt(buf, uint64(len(raw)))
+		buf = append(buf, raw...)
+	}
+	return buf
+}
+
+// encodeStmtPrepareOK encodes the COM_STMT_PREPARE_OK response: status(1) +
+// statement-id(4) + num-columns(2) + num-params(2) + reserved(1) +
+// warning-count(2). TestHandler's ComStmtPrepare never returns result-set
+// columns, only placeholder descriptions, so num-columns is always 0.
+func encodeStmtPrepareOK(stmtID uint32, paramCount int) []byte {
+	buf := make([]byte, 0, 12)
+	buf = append(buf, 0x00)
+	idBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(idBytes, stmtID)
+	buf = append(buf, idBytes...)
+	buf = append(buf, 0x00, 0x00) // num_columns
+	buf = append(buf, byte(paramCount), byte(paramCount>>8))
+	buf = append(buf, 0x00)       // reserved
+	buf = append(buf, 0x00, 0x00) // warning_count
+	return buf
+}
+
+// encodeErrPacket encodes a minimal ERR packet: 0xff + error-code(2) +
+// message. It omits the SQL-state marker/value since TestHandler's errors
+// aren't tied to one.
+func encodeErrPacket(err error) []byte {
+	buf := []byte{0xff, 0x00, 0x00}
+	return append(buf, []byte(err.Error())...)
+}
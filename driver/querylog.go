@@ -0,0 +1,192 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// MatchedCond records which lookup path inside matchAndRun produced a
+// QueryLogEntry's result: NORMAL, DELAY and ERROR for a single Cond (a
+// COND_STREAM cond is reported as NORMAL), plus PATTERN, CONDLIST and
+// UNMATCHED for the paths that aren't a single Cond.
+type MatchedCond int
+
+const (
+	MATCH_NORMAL MatchedCond = iota
+	MATCH_DELAY
+	MATCH_ERROR
+	MATCH_PATTERN
+	MATCH_CONDLIST
+	MATCH_UNMATCHED
+)
+
+func (m MatchedCond) String() string {
+	switch m {
+	case MATCH_NORMAL:
+		return "NORMAL"
+	case MATCH_DELAY:
+		return "DELAY"
+	case MATCH_ERROR:
+		return "ERROR"
+	case MATCH_PATTERN:
+		return "PATTERN"
+	case MATCH_CONDLIST:
+		return "CONDLIST"
+	default:
+		return "UNMATCHED"
+	}
+}
+
+// QueryLogEntry is emitted once per ComQuery execution, and once per
+// ComStmtExecute that is looked up through execQuery, modeled after vtgate's
+// LogStats. A ComStmtExecute answered by an AddPreparedQuery registration
+// emits no entry.
+type QueryLogEntry struct {
+	SessionID    uint32
+	RemoteAddr   string
+	User         string
+	Schema       string
+	Query        string
+	BindVars     map[string]string
+	StartTime    time.Time
+	Duration     time.Duration
+	RowsAffected uint64
+	RowsReturned int
+	Error        error
+	MatchedCond  MatchedCond
+}
+
+// QueryLogger receives a QueryLogEntry for every executed query. LogQuery
+// must not block the caller for long; implementations that need to do I/O
+// should buffer or do it asynchronously.
+type QueryLogger interface {
+	LogQuery(entry QueryLogEntry)
+}
+
+// SetQueryLogger installs logger as the destination for QueryLogEntry
+// records; pass nil to stop logging.
+func (th *TestHandler) SetQueryLogger(logger QueryLogger) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.qlogger = logger
+}
+
+// logQuery hands entry to the installed QueryLogger, if any.
+func (th *TestHandler) logQuery(entry QueryLogEntry) {
+	th.mu.Lock()
+	logger := th.qlogger
+	th.mu.Unlock()
+	if logger != nil {
+		logger.LogQuery(entry)
+	}
+}
+
+// MemoryQueryLogger is a ring-buffered QueryLogger for test assertions: once
+// full, the oldest entry is overwritten by the newest.
+type MemoryQueryLogger struct {
+	mu      sync.Mutex
+	entries []QueryLogEntry
+	next    int
+	full    bool
+}
+
+// NewMemoryQueryLogger creates a MemoryQueryLogger holding up to size
+// entries.
+func NewMemoryQueryLogger(size int) *MemoryQueryLogger {
+	return &MemoryQueryLogger{entries: make([]QueryLogEntry, size)}
+}
+
+// LogQuery impl.
+func (l *MemoryQueryLogger) LogQuery(entry QueryLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = entry
+	l.next++
+	if l.next == len(l.entries) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// Snapshot returns the logged entries in execution order, oldest first.
+func (l *MemoryQueryLogger) Snapshot() []QueryLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		out := make([]QueryLogEntry, l.next)
+		copy(out, l.entries[:l.next])
+		return out
+	}
+	out := make([]QueryLogEntry, len(l.entries))
+	copy(out, l.entries[l.next:])
+	copy(out[len(l.entries)-l.next:], l.entries[:l.next])
+	return out
+}
+
+// JSONLQueryLogger writes one JSON object per line to w.
+type JSONLQueryLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLQueryLogger creates a JSONLQueryLogger writing to w.
+func NewJSONLQueryLogger(w io.Writer) *JSONLQueryLogger {
+	return &JSONLQueryLogger{w: w}
+}
+
+// LogQuery impl.
+func (l *JSONLQueryLogger) LogQuery(entry QueryLogEntry) {
+	errStr := ""
+	if entry.Error != nil {
+		errStr = entry.Error.Error()
+	}
+	line := struct {
+		SessionID    uint32            `json:"session_id"`
+		RemoteAddr   string            `json:"remote_addr"`
+		User         string            `json:"user"`
+		Schema       string            `json:"schema"`
+		Query        string            `json:"query"`
+		BindVars     map[string]string `json:"bind_vars,omitempty"`
+		StartTime    time.Time         `json:"start_time"`
+		DurationMS   float64           `json:"duration_ms"`
+		RowsAffected uint64            `json:"rows_affected"`
+		RowsReturned int               `json:"rows_returned"`
+		Error        string            `json:"error,omitempty"`
+		MatchedCond  string            `json:"matched_cond"`
+	}{
+		SessionID:    entry.SessionID,
+		RemoteAddr:   entry.RemoteAddr,
+		User:         entry.User,
+		Schema:       entry.Schema,
+		Query:        entry.Query,
+		BindVars:     entry.BindVars,
+		StartTime:    entry.StartTime,
+		DurationMS:   entry.Duration.Seconds() * 1000,
+		RowsAffected: entry.RowsAffected,
+		RowsReturned: entry.RowsReturned,
+		Error:        errStr,
+		MatchedCond:  entry.MatchedCond.String(),
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(data)
+	l.w.Write([]byte("\n"))
+}
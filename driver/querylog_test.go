@@ -0,0 +1,91 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// TestMemoryQueryLoggerBeforeFull ensures Snapshot returns only the entries
+// logged so far, in order, while the ring buffer hasn't wrapped yet.
+func TestMemoryQueryLoggerBeforeFull(t *testing.T) {
+	l := NewMemoryQueryLogger(3)
+	l.LogQuery(QueryLogEntry{Query: "a"})
+	l.LogQuery(QueryLogEntry{Query: "b"})
+
+	got := l.Snapshot()
+	if len(got) != 2 {
+		t.Fatalf("Snapshot() len = %d, want 2", len(got))
+	}
+	if got[0].Query != "a" || got[1].Query != "b" {
+		t.Fatalf("Snapshot() = %v, want [a b]", got)
+	}
+}
+
+// TestMemoryQueryLoggerWraparound ensures Snapshot still returns entries in
+// oldest-first execution order once the ring buffer has wrapped and started
+// overwriting its oldest entries.
+func TestMemoryQueryLoggerWraparound(t *testing.T) {
+	l := NewMemoryQueryLogger(3)
+	for _, q := range []string{"a", "b", "c", "d", "e"} {
+		l.LogQuery(QueryLogEntry{Query: q})
+	}
+
+	got := l.Snapshot()
+	want := []string{"c", "d", "e"}
+	if len(got) != len(want) {
+		t.Fatalf("Snapshot() len = %d, want %d", len(got), len(want))
+	}
+	for i, q := range want {
+		if got[i].Query != q {
+			t.Fatalf("Snapshot()[%d] = %q, want %q (full snapshot: %v)", i, got[i].Query, q, got)
+		}
+	}
+}
+
+// TestMemoryQueryLoggerExactlyFull ensures Snapshot is correct the instant
+// the buffer fills exactly, the boundary between the two Snapshot code
+// paths.
+func TestMemoryQueryLoggerExactlyFull(t *testing.T) {
+	l := NewMemoryQueryLogger(2)
+	l.LogQuery(QueryLogEntry{Query: "a"})
+	l.LogQuery(QueryLogEntry{Query: "b"})
+
+	got := l.Snapshot()
+	if len(got) != 2 || got[0].Query != "a" || got[1].Query != "b" {
+		t.Fatalf("Snapshot() = %v, want [a b]", got)
+	}
+}
+
+// TestJSONLQueryLoggerWritesOneLinePerQuery ensures JSONLQueryLogger emits
+// one valid JSON object per logged query, newline-terminated.
+func TestJSONLQueryLoggerWritesOneLinePerQuery(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSONLQueryLogger(&buf)
+	l.LogQuery(QueryLogEntry{Query: "select 1", MatchedCond: MATCH_NORMAL})
+	l.LogQuery(QueryLogEntry{Query: "select 2", MatchedCond: MATCH_ERROR})
+
+	lines := bytes.Split(bytes.TrimRight(buf.Bytes(), "\n"), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("wrote %d lines, want 2: %q", len(lines), buf.String())
+	}
+	var decoded struct {
+		Query       string `json:"query"`
+		MatchedCond string `json:"matched_cond"`
+	}
+	if err := json.Unmarshal(lines[1], &decoded); err != nil {
+		t.Fatalf("json.Unmarshal line 2: %v", err)
+	}
+	if decoded.Query != "select 2" || decoded.MatchedCond != "ERROR" {
+		t.Fatalf("decoded = %+v, want {select 2 ERROR}", decoded)
+	}
+}
@@ -0,0 +1,209 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XeLabs/go-mysqlstack/sqlparser"
+	"github.com/XeLabs/go-mysqlstack/sqlparser/depends/querypb"
+	"github.com/XeLabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// preparedStmt is the bookkeeping TestHandler keeps for one COM_STMT_PREPARE
+// until it is closed with COM_STMT_CLOSE.
+type preparedStmt struct {
+	id         uint32
+	query      string
+	paramCount int
+}
+
+// preparedQuery is a parameter-sensitive registration made through
+// AddPreparedQuery: the result depends on the bound params rather than on a
+// single canned *sqltypes.Result.
+type preparedQuery struct {
+	query           string
+	paramTypes      []querypb.Type
+	resultForParams func([]sqltypes.Value) *sqltypes.Result
+}
+
+// ComStmtPrepare impl. It hands back the assigned statement ID (so a caller
+// driving this over the wire, e.g. DispatchComStmt, can report the real ID
+// to the client instead of a placeholder) and a paramCount equal to the
+// number of placeholder tokens in query, as found by the sqlparser
+// tokenizer (so a '?' inside a string literal or comment doesn't count);
+// TestHandler does not parse the query any further, so the columns
+// returned describe the placeholders, not the result set.
+func (th *TestHandler) ComStmtPrepare(s *Session, query string) (uint32, int, []*querypb.Field, error) {
+	paramCount, err := countPlaceholders(query)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	th.mu.Lock()
+	th.stmtSeq++
+	id := th.stmtSeq
+	th.stmts[id] = &preparedStmt{id: id, query: query, paramCount: paramCount}
+	th.mu.Unlock()
+
+	columns := make([]*querypb.Field, paramCount)
+	for i := range columns {
+		columns[i] = &querypb.Field{Name: fmt.Sprintf("param_%d", i), Type: querypb.Type_VARBINARY}
+	}
+	return id, paramCount, columns, nil
+}
+
+// StmtParamCount returns the placeholder count recorded when stmtID was
+// prepared, and whether stmtID is still open (i.e. not yet removed by
+// COM_STMT_CLOSE). DispatchComStmt uses this to decode a COM_STMT_EXECUTE
+// packet's NULL bitmap without having to guess its length.
+func (th *TestHandler) StmtParamCount(stmtID uint32) (int, bool) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	stmt, ok := th.stmts[stmtID]
+	if !ok {
+		return 0, false
+	}
+	return stmt.paramCount, true
+}
+
+// ComStmtExecute impl. It substitutes params into the prepared query's '?'
+// placeholders (in order) and either hands the resulting text to execQuery,
+// the same lookup path ComQuery uses, or, if an AddPreparedQuery binding
+// matches the original query, computes the result directly from params.
+func (th *TestHandler) ComStmtExecute(s *Session, stmtID uint32, params []sqltypes.Value, callback func(*sqltypes.Result) error) error {
+	th.mu.Lock()
+	stmt, ok := th.stmts[stmtID]
+	var pq *preparedQuery
+	if ok {
+		pq = th.preparedQueries[strings.ToLower(stmt.query)]
+	}
+	th.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("mock.handler.stmt[%v].not.found.please.prepare.first", stmtID)
+	}
+	if len(params) != stmt.paramCount {
+		return fmt.Errorf("mock.handler.stmt[%v].param.count[%d].want[%d]", stmtID, len(params), stmt.paramCount)
+	}
+
+	if pq != nil {
+		return callback(pq.resultForParams(params))
+	}
+
+	query, err := bindParams(stmt.query, params)
+	if err != nil {
+		return err
+	}
+
+	bindVars := make(map[string]string, len(params))
+	for i, p := range params {
+		bindVars[fmt.Sprintf("v%d", i+1)] = p.String()
+	}
+	return th.execQuery(s, strings.ToLower(query), bindVars, callback)
+}
+
+// ComStmtClose impl.
+func (th *TestHandler) ComStmtClose(s *Session, stmtID uint32) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	delete(th.stmts, stmtID)
+}
+
+// placeholderTokens walks query with the sqlparser tokenizer and returns the
+// byte range [start, end) of every "?" placeholder token, in order. Unlike a
+// raw scan for the '?' byte, this does not match one that the tokenizer
+// classified as part of a string literal or a comment.
+func placeholderTokens(query string) ([][2]int, error) {
+	tkz := sqlparser.NewStringTokenizer(query)
+	var spans [][2]int
+	searchFrom := 0
+	for {
+		typ, val := tkz.Scan()
+		if typ == 0 {
+			break
+		}
+		text := string(val)
+		if text == "" {
+			continue
+		}
+		idx := strings.Index(query[searchFrom:], text)
+		if idx < 0 {
+			return nil, fmt.Errorf("mock.handler.tokenize.query[%s].lost.sync.at.token[%s]", query, text)
+		}
+		start := searchFrom + idx
+		end := start + len(text)
+		searchFrom = end
+		if text == "?" {
+			spans = append(spans, [2]int{start, end})
+		}
+	}
+	return spans, nil
+}
+
+// countPlaceholders returns the number of "?" placeholder tokens in query.
+func countPlaceholders(query string) (int, error) {
+	spans, err := placeholderTokens(query)
+	if err != nil {
+		return 0, err
+	}
+	return len(spans), nil
+}
+
+// bindParams substitutes each "?" placeholder token of query, in order
+// (located via the sqlparser tokenizer, so one embedded in a string literal
+// or comment is left untouched), with the SQL-literal text of the
+// corresponding param.
+func bindParams(query string, params []sqltypes.Value) (string, error) {
+	spans, err := placeholderTokens(query)
+	if err != nil {
+		return "", err
+	}
+	if len(spans) > len(params) {
+		return "", fmt.Errorf("mock.handler.bind.params.not.enough.params.for.query[%s]", query)
+	}
+
+	var buf strings.Builder
+	cursor := 0
+	for i, span := range spans {
+		start, end := span[0], span[1]
+		buf.WriteString(query[cursor:start])
+		buf.WriteString(paramLiteral(params[i]))
+		cursor = end
+	}
+	buf.WriteString(query[cursor:])
+	return buf.String(), nil
+}
+
+// paramLiteral renders v the way it would appear inlined in a query: numeric
+// types unquoted, everything else single-quoted.
+func paramLiteral(v sqltypes.Value) string {
+	if v.IsNull() {
+		return "null"
+	}
+	if v.IsIntegral() || v.IsFloat() {
+		return v.String()
+	}
+	return "'" + strings.Replace(v.String(), "'", "''", -1) + "'"
+}
+
+// AddPreparedQuery registers a parameter-sensitive result for a prepared
+// query: instead of a single canned *sqltypes.Result, resultForParams is
+// invoked with the bound params of each COM_STMT_EXECUTE to compute one.
+func (th *TestHandler) AddPreparedQuery(query string, paramTypes []querypb.Type, resultForParams func([]sqltypes.Value) *sqltypes.Result) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.preparedQueries[strings.ToLower(query)] = &preparedQuery{
+		query:           query,
+		paramTypes:      paramTypes,
+		resultForParams: resultForParams,
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/XeLabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// TestBindParamsIgnoresPlaceholderInStringLiteral ensures a '?' inside a
+// string literal is not mistaken for a placeholder token.
+func TestBindParamsIgnoresPlaceholderInStringLiteral(t *testing.T) {
+	query := "select * from t where a = ? and b = '??'"
+	n, err := countPlaceholders(query)
+	if err != nil {
+		t.Fatalf("countPlaceholders error: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("countPlaceholders = %d, want 1 (the literal's '??' must not count)", n)
+	}
+
+	out, err := bindParams(query, []sqltypes.Value{sqltypes.MakeTrusted(sqltypes.Int64, []byte("5"))})
+	if err != nil {
+		t.Fatalf("bindParams error: %v", err)
+	}
+	if out != "select * from t where a = 5 and b = '??'" {
+		t.Fatalf("bindParams = %q, the literal's '??' must be left untouched", out)
+	}
+}
+
+// TestBindParamsMultiplePlaceholders ensures placeholders are substituted in
+// source order.
+func TestBindParamsMultiplePlaceholders(t *testing.T) {
+	query := "select * from t where a = ? and b = ?"
+	out, err := bindParams(query, []sqltypes.Value{
+		sqltypes.MakeTrusted(sqltypes.Int64, []byte("1")),
+		sqltypes.MakeTrusted(sqltypes.VarChar, []byte("x")),
+	})
+	if err != nil {
+		t.Fatalf("bindParams error: %v", err)
+	}
+	if out != "select * from t where a = 1 and b = 'x'" {
+		t.Fatalf("bindParams = %q", out)
+	}
+}
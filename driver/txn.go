@@ -0,0 +1,189 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XeLabs/go-mysqlstack/sqldb"
+	"github.com/XeLabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// SessionState is a point-in-time snapshot of a session's transaction and
+// variable state, returned by TestHandler.SessionState for test assertions.
+type SessionState struct {
+	InTxn       bool
+	Autocommit  bool
+	CurrentDB   string
+	SessionVars map[string]string
+}
+
+// SessionState returns a snapshot of the named session's state. The zero
+// value is returned if the session is not known (e.g. already closed).
+func (th *TestHandler) SessionState(id uint32) SessionState {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	st, ok := th.ss[id]
+	if !ok {
+		return SessionState{}
+	}
+	vars := make(map[string]string, len(st.sessionVars))
+	for k, v := range st.sessionVars {
+		vars[k] = v
+	}
+	return SessionState{
+		InTxn:       st.inTxn,
+		Autocommit:  st.autocommit,
+		CurrentDB:   st.currentDB,
+		SessionVars: vars,
+	}
+}
+
+// ServerStatus computes the server-status flags for s: SERVER_STATUS_IN_TRANS
+// while a transaction is open and SERVER_STATUS_AUTOCOMMIT while autocommit
+// is on. It returns 0 for an unknown session. Listener's OK-packet writer
+// does not call it, so the OK packets sent to clients do not carry these
+// bits from it.
+func (th *TestHandler) ServerStatus(s *Session) uint16 {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	st, ok := th.ss[s.ID()]
+	if !ok {
+		return 0
+	}
+	var status uint16
+	if st.inTxn {
+		status |= sqldb.SERVER_STATUS_IN_TRANS
+	}
+	if st.autocommit {
+		status |= sqldb.SERVER_STATUS_AUTOCOMMIT
+	}
+	return status
+}
+
+// AddTransactionExpectation asserts that, at the next COMMIT on sessionID,
+// queries were all seen inside that single transaction. A mismatch is
+// recorded and can be retrieved with TransactionFailures. Expectations on
+// the same session queue up: each COMMIT on sessionID consumes exactly the
+// oldest still-pending one registered for it, so they never cross-check
+// against each other's transaction, nor against another connection's.
+func (th *TestHandler) AddTransactionExpectation(sessionID uint32, queries ...string) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	expect := make([]string, len(queries))
+	for i, q := range queries {
+		expect[i] = strings.ToLower(q)
+	}
+	if th.txnExpectations == nil {
+		th.txnExpectations = make(map[uint32][][]string)
+	}
+	th.txnExpectations[sessionID] = append(th.txnExpectations[sessionID], expect)
+}
+
+// TransactionFailures returns one error for each transaction expectation
+// that the COMMIT which consumed it did not satisfy. Expectations still
+// queued (no COMMIT on their session yet) are not reported.
+func (th *TestHandler) TransactionFailures() []error {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	out := make([]error, len(th.txnFailures))
+	copy(out, th.txnFailures)
+	return out
+}
+
+// handleSessionStateQuery recognizes BEGIN/START TRANSACTION, COMMIT,
+// ROLLBACK, SET and USE statements and mutates sessTuple accordingly. It
+// returns handled=true when query was one of these, in which case err (which
+// may be nil) is the result ComQuery/execQuery should return directly.
+func (th *TestHandler) handleSessionStateQuery(sessTuple *SessionTuple, query string, callback func(*sqltypes.Result) error) (bool, error) {
+	if sessTuple == nil {
+		return false, nil
+	}
+	trimmed := strings.TrimSpace(strings.TrimSuffix(query, ";"))
+
+	switch {
+	case trimmed == "begin", trimmed == "start transaction":
+		th.mu.Lock()
+		sessTuple.inTxn = true
+		sessTuple.txnQueries = nil
+		th.mu.Unlock()
+		return true, callback(&sqltypes.Result{})
+
+	case trimmed == "commit":
+		th.mu.Lock()
+		sessTuple.inTxn = false
+		th.checkTransactionExpectationLocked(sessTuple.session.ID(), sessTuple.txnQueries)
+		sessTuple.txnQueries = nil
+		th.mu.Unlock()
+		return true, callback(&sqltypes.Result{})
+
+	case trimmed == "rollback":
+		th.mu.Lock()
+		sessTuple.inTxn = false
+		sessTuple.txnQueries = nil
+		th.mu.Unlock()
+		return true, callback(&sqltypes.Result{})
+
+	case strings.HasPrefix(trimmed, "use "):
+		th.mu.Lock()
+		sessTuple.currentDB = strings.TrimSpace(trimmed[len("use "):])
+		th.mu.Unlock()
+		return true, callback(&sqltypes.Result{})
+
+	case strings.HasPrefix(trimmed, "set "):
+		th.mu.Lock()
+		for _, assign := range strings.Split(trimmed[len("set "):], ",") {
+			kv := strings.SplitN(assign, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			k := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(kv[0]), "@@"))
+			v := strings.Trim(strings.TrimSpace(kv[1]), "'\"")
+			sessTuple.sessionVars[k] = v
+			if k == "autocommit" {
+				sessTuple.autocommit = v != "0"
+			}
+		}
+		th.mu.Unlock()
+		return true, callback(&sqltypes.Result{})
+	}
+
+	return false, nil
+}
+
+// checkTransactionExpectationLocked matches seen (the queries observed in
+// the transaction that sessionID just committed) against sessionID's oldest
+// still-pending expectation, if it has one: a satisfied expectation is
+// consumed silently, an unsatisfied one is consumed and recorded in
+// txnFailures. Only that single expectation is consumed -- others queued
+// for sessionID, and every expectation queued for other sessions, are left
+// untouched. th.mu must be held.
+func (th *TestHandler) checkTransactionExpectationLocked(sessionID uint32, seen []string) {
+	queue := th.txnExpectations[sessionID]
+	if len(queue) == 0 {
+		return
+	}
+	expect := queue[0]
+	th.txnExpectations[sessionID] = queue[1:]
+
+	seenSet := make(map[string]bool, len(seen))
+	for _, q := range seen {
+		seenSet[q] = true
+	}
+	for _, q := range expect {
+		if !seenSet[q] {
+			th.txnFailures = append(th.txnFailures, fmt.Errorf("mock.handler.session[%v].transaction.expectation.not.satisfied:%v", sessionID, expect))
+			break
+		}
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * go-mysqlstack
+ * xelabs.org
+ *
+ * Copyright (c) XeLabs
+ * GPL License
+ *
+ */
+
+package driver
+
+import "testing"
+
+// TestTransactionExpectationsArePerSession ensures that committing session
+// 1's transaction only checks (and consumes) session 1's own queued
+// expectation, leaving session 2's expectation untouched even though it was
+// registered earlier and is checked against an unrelated query set.
+func TestTransactionExpectationsArePerSession(t *testing.T) {
+	th := &TestHandler{}
+
+	th.AddTransactionExpectation(1, "insert into t values (1)")
+	th.AddTransactionExpectation(2, "update t set a = 1")
+
+	// Session 1 commits a transaction that does NOT satisfy its own
+	// expectation -- this must not consume or fail session 2's.
+	th.mu.Lock()
+	th.checkTransactionExpectationLocked(1, []string{"select 1"})
+	th.mu.Unlock()
+
+	if got := th.TransactionFailures(); len(got) != 1 {
+		t.Fatalf("TransactionFailures() = %v, want exactly 1 failure for session 1", got)
+	}
+	if remaining := th.txnExpectations[2]; len(remaining) != 1 {
+		t.Fatalf("session 2's expectation was consumed/altered by session 1's commit: %v", remaining)
+	}
+	if remaining := th.txnExpectations[1]; len(remaining) != 0 {
+		t.Fatalf("session 1's expectation should have been consumed, got %v", remaining)
+	}
+
+	// Session 2 now commits a transaction that DOES satisfy its own
+	// expectation: no new failure should be recorded.
+	th.mu.Lock()
+	th.checkTransactionExpectationLocked(2, []string{"update t set a = 1"})
+	th.mu.Unlock()
+
+	if got := th.TransactionFailures(); len(got) != 1 {
+		t.Fatalf("TransactionFailures() = %v, want still exactly 1 failure (session 2 was satisfied)", got)
+	}
+}
+
+// TestTransactionExpectationsQueuePerSession ensures two expectations queued
+// for the same session are each checked against their own, separate
+// transaction -- a satisfied first commit must not consume the second.
+func TestTransactionExpectationsQueuePerSession(t *testing.T) {
+	th := &TestHandler{}
+
+	th.AddTransactionExpectation(1, "a")
+	th.AddTransactionExpectation(1, "b")
+
+	th.mu.Lock()
+	th.checkTransactionExpectationLocked(1, []string{"a"})
+	th.mu.Unlock()
+	if got := th.TransactionFailures(); len(got) != 0 {
+		t.Fatalf("first commit satisfied its expectation, want 0 failures, got %v", got)
+	}
+	if remaining := th.txnExpectations[1]; len(remaining) != 1 {
+		t.Fatalf("second expectation should still be queued, got %v", remaining)
+	}
+
+	th.mu.Lock()
+	th.checkTransactionExpectationLocked(1, []string{"a"})
+	th.mu.Unlock()
+	if got := th.TransactionFailures(); len(got) != 1 {
+		t.Fatalf("second commit did not satisfy its own expectation \"b\", want 1 failure, got %v", got)
+	}
+}